@@ -1,9 +1,11 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -16,48 +18,1568 @@ type CarbonCreditContract struct {
 
 // CarbonCredit represents a carbon credit in the system
 type CarbonCredit struct {
-	ID              string    `json:"id"`
-	ProjectID       string    `json:"projectId"`
-	OwnerID         string    `json:"ownerId"`
-	Amount          float64   `json:"amount"`
-	Type            string    `json:"type"` // blue_carbon, mangrove, seagrass, etc.
-	Status          string    `json:"status"` // pending, issued, transferred, retired
-	IssuedDate      time.Time `json:"issuedDate"`
-	ExpiryDate      time.Time `json:"expiryDate"`
-	VerificationID  string    `json:"verificationId"`
-	MRVReportID     string    `json:"mrvReportId"`
-	BlockchainHash  string    `json:"blockchainHash"`
-	Metadata        map[string]interface{} `json:"metadata"`
+	ID             string                 `json:"id"`
+	ProjectID      string                 `json:"projectId"`
+	OwnerID        string                 `json:"ownerId"`
+	Amount         float64                `json:"amount"`
+	Type           string                 `json:"type"`   // blue_carbon, mangrove, seagrass, etc.
+	Status         string                 `json:"status"` // pending, issued, transferred, retired, revoked
+	IssuedDate     time.Time              `json:"issuedDate"`
+	ExpiryDate     time.Time              `json:"expiryDate"`
+	VerificationID string                 `json:"verificationId"`
+	MRVReportID    string                 `json:"mrvReportId"`
+	AttestationID  string                 `json:"attestationId"`
+	BlockchainHash string                 `json:"blockchainHash"`
+	Metadata       map[string]interface{} `json:"metadata"`
+	// ParentCreditIDs traces provenance when this credit was produced by
+	// Split or Merge rather than CreateCredit; empty for original issuance.
+	ParentCreditIDs []string  `json:"parentCreditIds,omitempty"`
 	CreatedAt       time.Time `json:"createdAt"`
 	UpdatedAt       time.Time `json:"updatedAt"`
 }
 
 // CreditTransfer represents a transfer of carbon credits
 type CreditTransfer struct {
-	ID              string    `json:"id"`
-	FromOwnerID     string    `json:"fromOwnerId"`
-	ToOwnerID       string    `json:"toOwnerId"`
-	CreditID        string    `json:"creditId"`
-	Amount          float64   `json:"amount"`
-	TransferType    string    `json:"transferType"` // sale, donation, retirement
-	Price           float64   `json:"price,omitempty"`
-	TransactionHash string    `json:"transactionHash"`
-	Status          string    `json:"status"` // pending, completed, failed
-	CreatedAt       time.Time `json:"createdAt"`
+	ID              string     `json:"id"`
+	FromOwnerID     string     `json:"fromOwnerId"`
+	ToOwnerID       string     `json:"toOwnerId"`
+	CreditID        string     `json:"creditId"`
+	Amount          float64    `json:"amount"`
+	TransferType    string     `json:"transferType"` // sale, donation, retirement
+	Price           float64    `json:"price,omitempty"`
+	TransactionHash string     `json:"transactionHash"`
+	Status          string     `json:"status"` // pending, completed, failed
+	CreatedAt       time.Time  `json:"createdAt"`
 	CompletedAt     *time.Time `json:"completedAt,omitempty"`
 }
 
-// CreditRetirement represents the retirement of carbon credits
-type CreditRetirement struct {
-	ID              string    `json:"id"`
-	CreditID        string    `json:"creditId"`
-	OwnerID         string    `json:"ownerId"`
-	Amount          float64   `json:"amount"`
-	RetirementType  string    `json:"retirementType"` // voluntary, compliance
-	Purpose         string    `json:"purpose"`
-	CertificateURL  string    `json:"certificateUrl,omitempty"`
-	RetirementDate  time.Time `json:"retirementDate"`
-	CreatedAt       time.Time `json:"createdAt"`
+// CreditRetirement represents the retirement of carbon credits
+type CreditRetirement struct {
+	ID             string    `json:"id"`
+	CreditID       string    `json:"creditId"`
+	OwnerID        string    `json:"ownerId"`
+	Amount         float64   `json:"amount"`
+	RetirementType string    `json:"retirementType"` // voluntary, compliance, bridge
+	Purpose        string    `json:"purpose"`
+	CertificateURL string    `json:"certificateUrl,omitempty"`
+	RetirementDate time.Time `json:"retirementDate"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// MRVAttestation represents a signed measurement/reporting/verification bundle
+// backing the issuance of a carbon credit. The raw sensor payload (satellite,
+// drone, or IoT readings) is never stored on-chain; only its content hash is,
+// alongside the verifier's signature over that hash together with the
+// credit ID, methodology version, project and amount (see attestationMessage).
+type MRVAttestation struct {
+	ID                 string    `json:"id"`
+	CreditID           string    `json:"creditId"`
+	RawPayloadHash     string    `json:"rawPayloadHash"`
+	VerifierDID        string    `json:"verifierDid"`
+	Signature          string    `json:"signature"`
+	MethodologyVersion string    `json:"methodologyVersion"`
+	MeasurementStart   time.Time `json:"measurementStart"`
+	MeasurementEnd     time.Time `json:"measurementEnd"`
+	CreatedAt          time.Time `json:"createdAt"`
+}
+
+// Verifier represents an entity registered to sign MRV attestations
+type Verifier struct {
+	DID          string     `json:"did"`
+	PublicKey    string     `json:"publicKey"`
+	Active       bool       `json:"active"`
+	RegisteredAt time.Time  `json:"registeredAt"`
+	RevokedAt    *time.Time `json:"revokedAt,omitempty"`
+}
+
+// RegisterVerifier adds an MRV verifier to the on-chain registry. publicKey
+// is the verifier's hex-encoded ed25519 public key; the matching private key
+// never appears on-chain and is used off-chain to sign attestations.
+func (s *CarbonCreditContract) RegisterVerifier(ctx contractapi.TransactionContextInterface, did, publicKey string) error {
+	key := "verifier-" + did
+
+	if _, err := decodeEd25519PublicKey(publicKey); err != nil {
+		return err
+	}
+
+	existingJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existingJSON != nil {
+		return fmt.Errorf("the verifier %s is already registered", did)
+	}
+
+	verifier := Verifier{
+		DID:          did,
+		PublicKey:    publicKey,
+		Active:       true,
+		RegisteredAt: time.Now(),
+	}
+
+	verifierJSON, err := json.Marshal(verifier)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, verifierJSON)
+}
+
+// RevokeVerifier marks a registered verifier as inactive so its signatures
+// are no longer accepted by VerifyAttestation
+func (s *CarbonCreditContract) RevokeVerifier(ctx contractapi.TransactionContextInterface, did string) error {
+	verifier, err := s.readVerifier(ctx, did)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	verifier.Active = false
+	verifier.RevokedAt = &now
+
+	verifierJSON, err := json.Marshal(verifier)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState("verifier-"+did, verifierJSON)
+}
+
+// readVerifier returns the verifier stored in the world state with given DID
+func (s *CarbonCreditContract) readVerifier(ctx contractapi.TransactionContextInterface, did string) (*Verifier, error) {
+	verifierJSON, err := ctx.GetStub().GetState("verifier-" + did)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if verifierJSON == nil {
+		return nil, fmt.Errorf("the verifier %s is not registered", did)
+	}
+
+	var verifier Verifier
+	if err := json.Unmarshal(verifierJSON, &verifier); err != nil {
+		return nil, err
+	}
+
+	return &verifier, nil
+}
+
+// ReadAttestation returns the MRV attestation backing a credit
+func (s *CarbonCreditContract) ReadAttestation(ctx contractapi.TransactionContextInterface, creditID string) (*MRVAttestation, error) {
+	attestationJSON, err := ctx.GetStub().GetState("attestation-" + creditID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if attestationJSON == nil {
+		return nil, fmt.Errorf("no attestation found for credit %s", creditID)
+	}
+
+	var attestation MRVAttestation
+	if err := json.Unmarshal(attestationJSON, &attestation); err != nil {
+		return nil, err
+	}
+
+	return &attestation, nil
+}
+
+// VerifyAttestation checks a credit's stored MRV attestation against the
+// verifier registry, confirming the signing verifier is registered, active,
+// and that Signature is a valid ed25519 signature by that verifier's
+// registered public key over the attestation's bound payload
+func (s *CarbonCreditContract) VerifyAttestation(ctx contractapi.TransactionContextInterface, creditID string) (bool, error) {
+	attestation, err := s.ReadAttestation(ctx, creditID)
+	if err != nil {
+		return false, err
+	}
+
+	credit, err := s.ReadCredit(ctx, creditID)
+	if err != nil {
+		return false, err
+	}
+
+	verifier, err := s.readVerifier(ctx, attestation.VerifierDID)
+	if err != nil {
+		return false, err
+	}
+
+	if !verifier.Active {
+		return false, fmt.Errorf("verifier %s has been revoked", attestation.VerifierDID)
+	}
+
+	publicKey, err := decodeEd25519PublicKey(verifier.PublicKey)
+	if err != nil {
+		return false, err
+	}
+
+	signature, err := hex.DecodeString(attestation.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false, fmt.Errorf("attestation signature for credit %s is malformed", creditID)
+	}
+
+	message := attestationMessage(attestation.CreditID, attestation.RawPayloadHash, attestation.MethodologyVersion, credit.ProjectID, credit.Amount)
+	if !ed25519.Verify(publicKey, message, signature) {
+		return false, fmt.Errorf("attestation signature for credit %s does not verify against verifier %s", creditID, attestation.VerifierDID)
+	}
+
+	return true, nil
+}
+
+// attestationMessage is the byte string a verifier signs off-chain to
+// produce an MRVAttestation.Signature. Binding CreditID prevents a signature
+// minted for one credit from being replayed onto another; binding amount
+// and projectID ensures the verifier is actually attesting to the tonnage
+// and project being issued, not just the methodology and payload hash.
+func attestationMessage(creditID, rawPayloadHash, methodologyVersion, projectID string, amount float64) []byte {
+	return []byte(fmt.Sprintf("%s|%s|%s|%s|%f", creditID, rawPayloadHash, methodologyVersion, projectID, amount))
+}
+
+// decodeEd25519PublicKey parses a hex-encoded ed25519 public key, rejecting
+// anything that isn't a well-formed key of the right length
+func decodeEd25519PublicKey(publicKey string) (ed25519.PublicKey, error) {
+	decoded, err := hex.DecodeString(publicKey)
+	if err != nil || len(decoded) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be a hex-encoded ed25519 public key")
+	}
+	return ed25519.PublicKey(decoded), nil
+}
+
+// CreditBatch represents a batch of credit leaves onboarded in a single
+// transaction without materializing each CarbonCredit. Individual credits are
+// claimed lazily via ClaimCreditFromBatch, which verifies a leaf against
+// MerkleRoot before writing it, so provenance still traces back to the batch.
+// The batch record itself - including its bloom filter, which can run to
+// tens of kilobytes for a large batch - is written once and never rewritten;
+// per-leaf claims instead toggle a bit in a separate claimed-bitmap key (see
+// claimedBitmapKey), so claiming one leaf out of 100k doesn't require
+// rewriting the other 99,999 leaves' bloom filter on every call.
+type CreditBatch struct {
+	ID          string    `json:"id"`
+	BatchCID    string    `json:"batchCid"`
+	ProjectID   string    `json:"projectId"`
+	Methodology string    `json:"methodology"`
+	MerkleRoot  string    `json:"merkleRoot"`
+	Count       int       `json:"count"`
+	BloomFilter []byte    `json:"bloomFilter"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// claimedBitmapKey is the world-state key holding a batch's claimed-leaf
+// bitmap, stored apart from the batch record so claiming a leaf only ever
+// rewrites this small bitmap rather than the whole (potentially large) batch.
+func claimedBitmapKey(batchID string) string {
+	return batchID + "-claimed"
+}
+
+const (
+	bloomFilterBitsPerElement = 10 // ~1% false-positive rate at bloomFilterHashes hash functions
+	bloomFilterMinBits        = 1024
+	bloomFilterHashes         = 4
+)
+
+// bloomFilterSizeBits sizes a filter relative to the number of elements it
+// will hold, rather than a fixed size that degrades to a near-100% false
+// positive rate once count exceeds a few thousand
+func bloomFilterSizeBits(count int) int {
+	bits := count * bloomFilterBitsPerElement
+	if bits < bloomFilterMinBits {
+		bits = bloomFilterMinBits
+	}
+	if remainder := bits % 8; remainder != 0 {
+		bits += 8 - remainder
+	}
+	return bits
+}
+
+// CreateCreditsBatchStateless records a batch of pre-arranged credits as a
+// single world-state object instead of writing N individual CarbonCredits.
+// leafIDs is the full set of credit IDs the batch covers; it is only used to
+// populate the membership bloom filter checked by ClaimCreditFromBatch, it is
+// not itself the source of truth for inclusion - merkleRoot is.
+func (s *CarbonCreditContract) CreateCreditsBatchStateless(ctx contractapi.TransactionContextInterface, batchCID, merkleRoot string, count int, projectID, methodology string, leafIDs []string) error {
+	batchID := "batch-" + batchCID
+
+	existingJSON, err := ctx.GetStub().GetState(batchID)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existingJSON != nil {
+		return fmt.Errorf("the batch %s already exists", batchCID)
+	}
+
+	if count <= 0 {
+		return fmt.Errorf("batch count must be positive")
+	}
+	if len(leafIDs) != count {
+		return fmt.Errorf("expected %d leaf ids, got %d", count, len(leafIDs))
+	}
+
+	filter := make([]byte, bloomFilterSizeBits(count)/8)
+	for _, leafID := range leafIDs {
+		bloomAdd(filter, leafID)
+	}
+
+	batch := CreditBatch{
+		ID:          batchID,
+		BatchCID:    batchCID,
+		ProjectID:   projectID,
+		Methodology: methodology,
+		MerkleRoot:  merkleRoot,
+		Count:       count,
+		BloomFilter: filter,
+		CreatedAt:   time.Now(),
+	}
+
+	batchJSON, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(batchID, batchJSON); err != nil {
+		return fmt.Errorf("failed to put batch to world state: %v", err)
+	}
+
+	return ctx.GetStub().PutState(claimedBitmapKey(batchID), make([]byte, (count+7)/8))
+}
+
+// ReadBatch returns the credit batch stored in the world state with given id
+func (s *CarbonCreditContract) ReadBatch(ctx contractapi.TransactionContextInterface, batchID string) (*CreditBatch, error) {
+	batchJSON, err := ctx.GetStub().GetState(batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if batchJSON == nil {
+		return nil, fmt.Errorf("the batch %s does not exist", batchID)
+	}
+
+	var batch CreditBatch
+	if err := json.Unmarshal(batchJSON, &batch); err != nil {
+		return nil, err
+	}
+
+	return &batch, nil
+}
+
+// readClaimedBitmap returns the claimed-leaf bitmap for batchID
+func (s *CarbonCreditContract) readClaimedBitmap(ctx contractapi.TransactionContextInterface, batchID string) ([]byte, error) {
+	bitmap, err := ctx.GetStub().GetState(claimedBitmapKey(batchID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if bitmap == nil {
+		return nil, fmt.Errorf("no claimed bitmap found for batch %s", batchID)
+	}
+
+	return bitmap, nil
+}
+
+// ClaimCreditFromBatch materializes a single CarbonCredit out of a
+// stateless batch. It checks the leaf's membership against the batch's bloom
+// filter, verifies merkleProof against the batch's Merkle root, and rejects
+// leaves that have already been claimed using the batch's claimed bitmap.
+// Only the claimed bitmap - not the batch record itself - is rewritten per claim.
+func (s *CarbonCreditContract) ClaimCreditFromBatch(ctx contractapi.TransactionContextInterface, batchID string, leafIndex int, merkleProof []string, creditID, ownerID string, amount float64, creditType string) error {
+	batch, err := s.ReadBatch(ctx, batchID)
+	if err != nil {
+		return err
+	}
+
+	if leafIndex < 0 || leafIndex >= batch.Count {
+		return fmt.Errorf("leaf index %d out of range for batch %s", leafIndex, batchID)
+	}
+
+	if !bloomContains(batch.BloomFilter, creditID) {
+		return fmt.Errorf("credit %s is not a member of batch %s", creditID, batchID)
+	}
+
+	claimed, err := s.readClaimedBitmap(ctx, batch.ID)
+	if err != nil {
+		return err
+	}
+	if bitmapIsSet(claimed, leafIndex) {
+		return fmt.Errorf("leaf %d of batch %s has already been claimed", leafIndex, batchID)
+	}
+
+	leafHash := hashBatchLeaf(creditID, batch.ProjectID, ownerID, amount, creditType)
+	if !verifyMerkleProof(leafHash, leafIndex, merkleProof, batch.MerkleRoot) {
+		return fmt.Errorf("merkle proof for leaf %d of batch %s does not verify", leafIndex, batchID)
+	}
+
+	exists, err := s.CreditExists(ctx, creditID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the credit %s already exists", creditID)
+	}
+
+	bitmapSet(claimed, leafIndex)
+	if err := ctx.GetStub().PutState(claimedBitmapKey(batch.ID), claimed); err != nil {
+		return fmt.Errorf("failed to put claimed bitmap to world state: %v", err)
+	}
+
+	credit := CarbonCredit{
+		ID:             creditID,
+		ProjectID:      batch.ProjectID,
+		OwnerID:        ownerID,
+		Amount:         amount,
+		Type:           creditType,
+		Status:         "issued",
+		IssuedDate:     time.Now(),
+		ExpiryDate:     time.Now().AddDate(10, 0, 0),
+		BlockchainHash: ctx.GetStub().GetTxID(),
+		Metadata: map[string]interface{}{
+			"batchId":   batch.ID,
+			"leafIndex": leafIndex,
+		},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	creditJSON, err := json.Marshal(credit)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(creditID, creditJSON); err != nil {
+		return err
+	}
+
+	return s.putBalance(ctx, &CreditBalance{CreditID: creditID, OwnerID: ownerID, Amount: amount})
+}
+
+// hashBatchLeaf derives the leaf hash a batch's Merkle tree was built over
+func hashBatchLeaf(creditID, projectID, ownerID string, amount float64, creditType string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%f|%s", creditID, projectID, ownerID, amount, creditType)))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyMerkleProof recomputes the root from a leaf hash, its index, and a
+// bottom-up list of sibling hashes, returning whether it matches root
+func verifyMerkleProof(leafHash string, leafIndex int, proof []string, root string) bool {
+	current := leafHash
+	index := leafIndex
+	for _, sibling := range proof {
+		if index%2 == 0 {
+			current = hashPair(current, sibling)
+		} else {
+			current = hashPair(sibling, current)
+		}
+		index /= 2
+	}
+	return current == root
+}
+
+func hashPair(left, right string) string {
+	sum := sha256.Sum256([]byte(left + right))
+	return hex.EncodeToString(sum[:])
+}
+
+// bloomAdd and bloomContains implement a bloom filter over leaf IDs, sized
+// by the caller via bloomFilterSizeBits, used as a cheap pre-check before
+// the more expensive Merkle proof verification
+func bloomAdd(filter []byte, leafID string) {
+	bits := len(filter) * 8
+	for i := 0; i < bloomFilterHashes; i++ {
+		idx := bloomHash(leafID, i, bits)
+		filter[idx/8] |= 1 << uint(idx%8)
+	}
+}
+
+func bloomContains(filter []byte, leafID string) bool {
+	bits := len(filter) * 8
+	for i := 0; i < bloomFilterHashes; i++ {
+		idx := bloomHash(leafID, i, bits)
+		if filter[idx/8]&(1<<uint(idx%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomHash(leafID string, seed, bits int) int {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", seed, leafID)))
+	var v uint64
+	for _, b := range sum[:8] {
+		v = v<<8 | uint64(b)
+	}
+	return int(v % uint64(bits))
+}
+
+func bitmapSet(bitmap []byte, index int) {
+	bitmap[index/8] |= 1 << uint(index%8)
+}
+
+func bitmapIsSet(bitmap []byte, index int) bool {
+	return bitmap[index/8]&(1<<uint(index%8)) != 0
+}
+
+// CreditBalance tracks how much of a CarbonCredit a given owner currently
+// holds. CarbonCredit itself is an immutable issuance envelope; ownership and
+// quantity move exclusively through CreditBalance entries, keyed by the
+// composite key "balance~creditID~ownerID".
+type CreditBalance struct {
+	CreditID  string    `json:"creditId"`
+	OwnerID   string    `json:"ownerId"`
+	Amount    float64   `json:"amount"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// GetBalance returns how much of creditID ownerID currently holds. A missing
+// entry is not an error - it simply means ownerID has never held a balance
+// on that credit.
+func (s *CarbonCreditContract) GetBalance(ctx contractapi.TransactionContextInterface, creditID, ownerID string) (*CreditBalance, error) {
+	key, err := ctx.GetStub().CreateCompositeKey("balance", []string{creditID, ownerID})
+	if err != nil {
+		return nil, err
+	}
+
+	balanceJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if balanceJSON == nil {
+		return &CreditBalance{CreditID: creditID, OwnerID: ownerID, Amount: 0}, nil
+	}
+
+	var balance CreditBalance
+	if err := json.Unmarshal(balanceJSON, &balance); err != nil {
+		return nil, err
+	}
+
+	return &balance, nil
+}
+
+// putBalance writes a balance entry back to the world state
+func (s *CarbonCreditContract) putBalance(ctx contractapi.TransactionContextInterface, balance *CreditBalance) error {
+	key, err := ctx.GetStub().CreateCompositeKey("balance", []string{balance.CreditID, balance.OwnerID})
+	if err != nil {
+		return err
+	}
+
+	balance.UpdatedAt = time.Now()
+	balanceJSON, err := json.Marshal(balance)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, balanceJSON)
+}
+
+// GetHoldersOf returns every owner currently holding a positive balance of creditID
+func (s *CarbonCreditContract) GetHoldersOf(ctx contractapi.TransactionContextInterface, creditID string) ([]*CreditBalance, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("balance", []string{creditID})
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	var holders []*CreditBalance
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var balance CreditBalance
+		if err := json.Unmarshal(kv.Value, &balance); err != nil {
+			return nil, err
+		}
+		if balance.Amount > 0 {
+			holders = append(holders, &balance)
+		}
+	}
+
+	return holders, nil
+}
+
+// Transfer moves amount of creditID from fromOwnerID's balance to
+// toOwnerID's balance, without touching the CarbonCredit issuance envelope
+func (s *CarbonCreditContract) Transfer(ctx contractapi.TransactionContextInterface, creditID, fromOwnerID, toOwnerID string, amount float64) error {
+	if amount <= 0 {
+		return fmt.Errorf("transfer amount must be positive")
+	}
+
+	credit, err := s.ReadCredit(ctx, creditID)
+	if err != nil {
+		return err
+	}
+	if credit.Status == "pending" {
+		return fmt.Errorf("credit %s has not been issued", creditID)
+	}
+
+	from, err := s.GetBalance(ctx, creditID, fromOwnerID)
+	if err != nil {
+		return err
+	}
+	if from.Amount < amount {
+		return fmt.Errorf("insufficient balance for %s on credit %s. Available: %f, Requested: %f", fromOwnerID, creditID, from.Amount, amount)
+	}
+
+	to, err := s.GetBalance(ctx, creditID, toOwnerID)
+	if err != nil {
+		return err
+	}
+
+	from.Amount -= amount
+	to.Amount += amount
+
+	if err := s.putBalance(ctx, from); err != nil {
+		return err
+	}
+	return s.putBalance(ctx, to)
+}
+
+// Split carves amount off of ownerID's balance on creditID into a brand new
+// CarbonCredit envelope (newCreditID), recording creditID as its parent so
+// provenance survives the split
+func (s *CarbonCreditContract) Split(ctx contractapi.TransactionContextInterface, creditID, ownerID, newCreditID string, amount float64) error {
+	if amount <= 0 {
+		return fmt.Errorf("split amount must be positive")
+	}
+
+	parent, err := s.ReadCredit(ctx, creditID)
+	if err != nil {
+		return err
+	}
+
+	exists, err := s.CreditExists(ctx, newCreditID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the credit %s already exists", newCreditID)
+	}
+
+	from, err := s.GetBalance(ctx, creditID, ownerID)
+	if err != nil {
+		return err
+	}
+	if from.Amount < amount {
+		return fmt.Errorf("insufficient balance for %s on credit %s. Available: %f, Requested: %f", ownerID, creditID, from.Amount, amount)
+	}
+	from.Amount -= amount
+	if err := s.putBalance(ctx, from); err != nil {
+		return err
+	}
+
+	child := CarbonCredit{
+		ID:              newCreditID,
+		ProjectID:       parent.ProjectID,
+		OwnerID:         ownerID,
+		Amount:          amount,
+		Type:            parent.Type,
+		Status:          "issued",
+		IssuedDate:      time.Now(),
+		ExpiryDate:      parent.ExpiryDate,
+		VerificationID:  parent.VerificationID,
+		AttestationID:   parent.AttestationID,
+		BlockchainHash:  ctx.GetStub().GetTxID(),
+		Metadata:        make(map[string]interface{}),
+		ParentCreditIDs: []string{creditID},
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+
+	childJSON, err := json.Marshal(child)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(newCreditID, childJSON); err != nil {
+		return err
+	}
+
+	return s.putBalance(ctx, &CreditBalance{CreditID: newCreditID, OwnerID: ownerID, Amount: amount})
+}
+
+// Merge combines ownerID's balances across creditIDs (which must share a
+// project and credit type) into a single new CarbonCredit envelope
+// (newCreditID), zeroing out the source balances
+func (s *CarbonCreditContract) Merge(ctx contractapi.TransactionContextInterface, creditIDs []string, ownerID, newCreditID string) error {
+	if len(creditIDs) < 2 {
+		return fmt.Errorf("merge requires at least two source credits")
+	}
+	seen := make(map[string]bool, len(creditIDs))
+	for _, id := range creditIDs {
+		if seen[id] {
+			return fmt.Errorf("credit %s is listed more than once in the merge group", id)
+		}
+		seen[id] = true
+	}
+
+	exists, err := s.CreditExists(ctx, newCreditID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the credit %s already exists", newCreditID)
+	}
+
+	var first *CarbonCredit
+	var balances []*CreditBalance
+	var total float64
+	for _, id := range creditIDs {
+		credit, err := s.ReadCredit(ctx, id)
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first = credit
+		} else if credit.ProjectID != first.ProjectID || credit.Type != first.Type {
+			return fmt.Errorf("credit %s is not compatible with the merge group (project/type mismatch)", id)
+		}
+
+		balance, err := s.GetBalance(ctx, id, ownerID)
+		if err != nil {
+			return err
+		}
+		if balance.Amount <= 0 {
+			return fmt.Errorf("owner %s holds no balance on credit %s", ownerID, id)
+		}
+
+		total += balance.Amount
+		balances = append(balances, balance)
+	}
+
+	for _, balance := range balances {
+		balance.Amount = 0
+		if err := s.putBalance(ctx, balance); err != nil {
+			return err
+		}
+	}
+
+	merged := CarbonCredit{
+		ID:              newCreditID,
+		ProjectID:       first.ProjectID,
+		OwnerID:         ownerID,
+		Amount:          total,
+		Type:            first.Type,
+		Status:          "issued",
+		IssuedDate:      time.Now(),
+		ExpiryDate:      first.ExpiryDate,
+		VerificationID:  first.VerificationID,
+		BlockchainHash:  ctx.GetStub().GetTxID(),
+		Metadata:        make(map[string]interface{}),
+		ParentCreditIDs: creditIDs,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+
+	mergedJSON, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(newCreditID, mergedJSON); err != nil {
+		return err
+	}
+
+	return s.putBalance(ctx, &CreditBalance{CreditID: newCreditID, OwnerID: ownerID, Amount: total})
+}
+
+// EscrowOffer represents a seller's standing offer to swap a balance of a
+// credit for an off-chain price, locked until Deadline. Accepting and
+// cancelling happen in separate transactions so buyer and seller never need
+// a trusted intermediary to hold funds or credits mid-swap.
+type EscrowOffer struct {
+	ID               string     `json:"id"`
+	CreditID         string     `json:"creditId"`
+	SellerID         string     `json:"sellerId"`
+	BuyerID          string     `json:"buyerId,omitempty"`
+	Amount           float64    `json:"amount"`
+	Price            float64    `json:"price"`
+	Deadline         time.Time  `json:"deadline"`
+	Status           string     `json:"status"` // open, accepted, cancelled
+	PaymentReference string     `json:"paymentReference,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	CompletedAt      *time.Time `json:"completedAt,omitempty"`
+}
+
+// EscrowOffer opens an offer to swap amount of creditID for price, locking
+// the amount out of sellerID's balance until it is accepted or cancelled
+func (s *CarbonCreditContract) EscrowOffer(ctx contractapi.TransactionContextInterface, offerID, creditID, sellerID string, amount, price float64, deadline string) error {
+	if amount <= 0 {
+		return fmt.Errorf("escrow amount must be positive")
+	}
+
+	existingJSON, err := ctx.GetStub().GetState("escrow-" + offerID)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existingJSON != nil {
+		return fmt.Errorf("the offer %s already exists", offerID)
+	}
+
+	deadlineTime, err := time.Parse(time.RFC3339, deadline)
+	if err != nil {
+		return fmt.Errorf("invalid deadline: %v", err)
+	}
+	if !deadlineTime.After(time.Now()) {
+		return fmt.Errorf("deadline must be in the future")
+	}
+
+	seller, err := s.GetBalance(ctx, creditID, sellerID)
+	if err != nil {
+		return err
+	}
+	if seller.Amount < amount {
+		return fmt.Errorf("insufficient balance for %s on credit %s. Available: %f, Requested: %f", sellerID, creditID, seller.Amount, amount)
+	}
+	seller.Amount -= amount
+	if err := s.putBalance(ctx, seller); err != nil {
+		return err
+	}
+
+	offer := EscrowOffer{
+		ID:        offerID,
+		CreditID:  creditID,
+		SellerID:  sellerID,
+		Amount:    amount,
+		Price:     price,
+		Deadline:  deadlineTime,
+		Status:    "open",
+		CreatedAt: time.Now(),
+	}
+
+	return s.putEscrowOffer(ctx, &offer)
+}
+
+// AcceptOffer completes an open offer, crediting buyerID's balance and
+// recording paymentReference as the buyer's proof of the off-chain payment
+func (s *CarbonCreditContract) AcceptOffer(ctx contractapi.TransactionContextInterface, offerID, buyerID, paymentReference string) error {
+	offer, err := s.ReadEscrowOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+
+	if offer.Status != "open" {
+		return fmt.Errorf("offer %s is not open", offerID)
+	}
+
+	if time.Now().After(offer.Deadline) {
+		return fmt.Errorf("offer %s has passed its deadline", offerID)
+	}
+
+	buyer, err := s.GetBalance(ctx, offer.CreditID, buyerID)
+	if err != nil {
+		return err
+	}
+	buyer.Amount += offer.Amount
+	if err := s.putBalance(ctx, buyer); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	offer.Status = "accepted"
+	offer.BuyerID = buyerID
+	offer.PaymentReference = paymentReference
+	offer.CompletedAt = &now
+
+	return s.putEscrowOffer(ctx, offer)
+}
+
+// CancelOffer releases an open offer's escrowed balance back to the seller.
+// Before the deadline only the seller may cancel; after the deadline anyone
+// may cancel to unwind a swap neither side completed.
+func (s *CarbonCreditContract) CancelOffer(ctx contractapi.TransactionContextInterface, offerID, callerID string) error {
+	offer, err := s.ReadEscrowOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+
+	if offer.Status != "open" {
+		return fmt.Errorf("offer %s is not open", offerID)
+	}
+
+	if callerID != offer.SellerID && time.Now().Before(offer.Deadline) {
+		return fmt.Errorf("only the seller may cancel offer %s before its deadline", offerID)
+	}
+
+	seller, err := s.GetBalance(ctx, offer.CreditID, offer.SellerID)
+	if err != nil {
+		return err
+	}
+	seller.Amount += offer.Amount
+	if err := s.putBalance(ctx, seller); err != nil {
+		return err
+	}
+
+	offer.Status = "cancelled"
+	return s.putEscrowOffer(ctx, offer)
+}
+
+// ReadEscrowOffer returns the escrow offer stored in the world state with given id
+func (s *CarbonCreditContract) ReadEscrowOffer(ctx contractapi.TransactionContextInterface, offerID string) (*EscrowOffer, error) {
+	offerJSON, err := ctx.GetStub().GetState("escrow-" + offerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if offerJSON == nil {
+		return nil, fmt.Errorf("the offer %s does not exist", offerID)
+	}
+
+	var offer EscrowOffer
+	if err := json.Unmarshal(offerJSON, &offer); err != nil {
+		return nil, err
+	}
+
+	return &offer, nil
+}
+
+func (s *CarbonCreditContract) putEscrowOffer(ctx contractapi.TransactionContextInterface, offer *EscrowOffer) error {
+	offerJSON, err := json.Marshal(offer)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState("escrow-"+offer.ID, offerJSON)
+}
+
+// SettlementPeriod represents a compliance-market accounting period over
+// which participants' retirement obligations are reconciled against what
+// they actually retired
+type SettlementPeriod struct {
+	ID           string     `json:"id"`
+	Start        time.Time  `json:"start"`
+	End          time.Time  `json:"end"`
+	Participants []string   `json:"participants"`
+	Status       string     `json:"status"` // open, closed, disputed
+	CreatedAt    time.Time  `json:"createdAt"`
+	ClosedAt     *time.Time `json:"closedAt,omitempty"`
+}
+
+// Obligation tracks one participant's required and actually-retired tonnage
+// within a settlement period
+type Obligation struct {
+	PeriodID      string    `json:"periodId"`
+	OwnerID       string    `json:"ownerId"`
+	TonnesCO2e    float64   `json:"tonnesCo2e"`
+	RetiredTonnes float64   `json:"retiredTonnes"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// SettlementStatement is the per-participant summary produced when a
+// settlement period closes. Signature holds the digest computed by
+// computeSettlementDigest, which is a plain hash, not a keyed signature.
+type SettlementStatement struct {
+	ID          string    `json:"id"`
+	PeriodID    string    `json:"periodId"`
+	OwnerID     string    `json:"ownerId"`
+	Obligation  float64   `json:"obligation"`
+	Retired     float64   `json:"retired"`
+	NetPosition float64   `json:"netPosition"` // obligation minus retired; positive is a shortfall
+	Signature   string    `json:"signature"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Dispute records a participant's objection to a settlement statement.
+// RaiseDispute accepts one at any time while the period is not already
+// disputed; no time-bounded dispute window is enforced.
+type Dispute struct {
+	ID          string    `json:"id"`
+	PeriodID    string    `json:"periodId"`
+	StatementID string    `json:"statementId"`
+	Reason      string    `json:"reason"`
+	RaisedAt    time.Time `json:"raisedAt"`
+}
+
+// OpenSettlementPeriod opens a new period for posting obligations and
+// retirements against a fixed set of participants
+func (s *CarbonCreditContract) OpenSettlementPeriod(ctx contractapi.TransactionContextInterface, periodID, start, end string, participants []string) error {
+	existingJSON, err := ctx.GetStub().GetState("period-" + periodID)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existingJSON != nil {
+		return fmt.Errorf("the settlement period %s already exists", periodID)
+	}
+
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return fmt.Errorf("invalid start: %v", err)
+	}
+	endTime, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		return fmt.Errorf("invalid end: %v", err)
+	}
+	if !endTime.After(startTime) {
+		return fmt.Errorf("end must be after start")
+	}
+	if len(participants) == 0 {
+		return fmt.Errorf("a settlement period requires at least one participant")
+	}
+
+	period := SettlementPeriod{
+		ID:           periodID,
+		Start:        startTime,
+		End:          endTime,
+		Participants: participants,
+		Status:       "open",
+		CreatedAt:    time.Now(),
+	}
+
+	return s.putSettlementPeriod(ctx, &period)
+}
+
+// RecordObligation adds tonnesCO2e to ownerID's required retirement for periodID
+func (s *CarbonCreditContract) RecordObligation(ctx contractapi.TransactionContextInterface, periodID, ownerID string, tonnesCO2e float64) error {
+	if tonnesCO2e <= 0 {
+		return fmt.Errorf("obligation amount must be positive")
+	}
+
+	period, err := s.readSettlementPeriod(ctx, periodID)
+	if err != nil {
+		return err
+	}
+	if period.Status != "open" {
+		return fmt.Errorf("settlement period %s is not open for postings", periodID)
+	}
+	if !stringInSlice(ownerID, period.Participants) {
+		return fmt.Errorf("%s is not a participant in settlement period %s", ownerID, periodID)
+	}
+
+	obligation, err := s.readObligation(ctx, periodID, ownerID)
+	if err != nil {
+		return err
+	}
+	obligation.TonnesCO2e += tonnesCO2e
+
+	return s.putObligation(ctx, obligation)
+}
+
+// SubmitRetirement links a previously-recorded CreditRetirement to a
+// participant's obligation for periodID. Each retirementID can be settled
+// exactly once across all periods, so the same retirement can't inflate
+// RetiredTonnes by repeat submission or be double-counted against another
+// period's obligation. The retirement's RetirementDate must also fall
+// within periodID's window, so a participant can't cherry-pick which open
+// period an out-of-window retirement satisfies.
+func (s *CarbonCreditContract) SubmitRetirement(ctx contractapi.TransactionContextInterface, periodID, ownerID, retirementID string) error {
+	period, err := s.readSettlementPeriod(ctx, periodID)
+	if err != nil {
+		return err
+	}
+	if period.Status != "open" {
+		return fmt.Errorf("settlement period %s is not open for postings", periodID)
+	}
+
+	retirementJSON, err := ctx.GetStub().GetState(retirementID)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if retirementJSON == nil {
+		return fmt.Errorf("the retirement %s does not exist", retirementID)
+	}
+	var retirement CreditRetirement
+	if err := json.Unmarshal(retirementJSON, &retirement); err != nil {
+		return err
+	}
+	if retirement.OwnerID != ownerID {
+		return fmt.Errorf("retirement %s does not belong to %s", retirementID, ownerID)
+	}
+	if retirement.RetirementDate.Before(period.Start) || retirement.RetirementDate.After(period.End) {
+		return fmt.Errorf("retirement %s falls outside the window [%s, %s] of settlement period %s", retirementID, period.Start, period.End, periodID)
+	}
+
+	settledKey := "settled-" + retirementID
+	settledJSON, err := ctx.GetStub().GetState(settledKey)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if settledJSON != nil {
+		return fmt.Errorf("retirement %s has already been settled against period %s", retirementID, string(settledJSON))
+	}
+
+	obligation, err := s.readObligation(ctx, periodID, ownerID)
+	if err != nil {
+		return err
+	}
+	obligation.RetiredTonnes += retirement.Amount
+
+	if err := s.putObligation(ctx, obligation); err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(settledKey, []byte(periodID))
+}
+
+// CloseSettlementPeriod computes each participant's net position (obligation
+// minus retired tonnage), stores a SettlementStatement per participant
+// carrying computeSettlementDigest's hash, and locks the period against
+// further postings
+func (s *CarbonCreditContract) CloseSettlementPeriod(ctx contractapi.TransactionContextInterface, periodID string) error {
+	period, err := s.readSettlementPeriod(ctx, periodID)
+	if err != nil {
+		return err
+	}
+	if period.Status != "open" {
+		return fmt.Errorf("settlement period %s is not open", periodID)
+	}
+
+	for _, ownerID := range period.Participants {
+		obligation, err := s.readObligation(ctx, periodID, ownerID)
+		if err != nil {
+			return err
+		}
+
+		netPosition := obligation.TonnesCO2e - obligation.RetiredTonnes
+		statement := SettlementStatement{
+			ID:          fmt.Sprintf("statement-%s-%s", periodID, ownerID),
+			PeriodID:    periodID,
+			OwnerID:     ownerID,
+			Obligation:  obligation.TonnesCO2e,
+			Retired:     obligation.RetiredTonnes,
+			NetPosition: netPosition,
+			Signature:   computeSettlementDigest(periodID, ownerID, netPosition),
+			CreatedAt:   time.Now(),
+		}
+
+		if err := s.putSettlementStatement(ctx, &statement); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	period.Status = "closed"
+	period.ClosedAt = &now
+
+	return s.putSettlementPeriod(ctx, period)
+}
+
+// GetOpenPeriods returns all settlement periods still accepting postings
+func (s *CarbonCreditContract) GetOpenPeriods(ctx contractapi.TransactionContextInterface) ([]*SettlementPeriod, error) {
+	iterator, err := ctx.GetStub().GetStateByRange("period-", "period.")
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	var periods []*SettlementPeriod
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var period SettlementPeriod
+		if err := json.Unmarshal(kv.Value, &period); err != nil {
+			return nil, err
+		}
+		if period.Status == "open" {
+			periods = append(periods, &period)
+		}
+	}
+
+	return periods, nil
+}
+
+// GetStatement returns ownerID's settlement statement for periodID
+func (s *CarbonCreditContract) GetStatement(ctx contractapi.TransactionContextInterface, periodID, ownerID string) (*SettlementStatement, error) {
+	statementJSON, err := ctx.GetStub().GetState(fmt.Sprintf("statement-%s-%s", periodID, ownerID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if statementJSON == nil {
+		return nil, fmt.Errorf("no statement found for %s in period %s", ownerID, periodID)
+	}
+
+	var statement SettlementStatement
+	if err := json.Unmarshal(statementJSON, &statement); err != nil {
+		return nil, err
+	}
+
+	return &statement, nil
+}
+
+// RaiseDispute records a participant's objection to a settlement statement
+// and freezes the period so it cannot be (re)closed until the dispute is
+// resolved out of band
+func (s *CarbonCreditContract) RaiseDispute(ctx contractapi.TransactionContextInterface, periodID, statementID, reason string) error {
+	period, err := s.readSettlementPeriod(ctx, periodID)
+	if err != nil {
+		return err
+	}
+	if period.Status == "disputed" {
+		return fmt.Errorf("settlement period %s already has an open dispute", periodID)
+	}
+
+	disputeID := fmt.Sprintf("dispute-%s-%d", periodID, time.Now().Unix())
+	dispute := Dispute{
+		ID:          disputeID,
+		PeriodID:    periodID,
+		StatementID: statementID,
+		Reason:      reason,
+		RaisedAt:    time.Now(),
+	}
+
+	disputeJSON, err := json.Marshal(dispute)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(disputeID, disputeJSON); err != nil {
+		return fmt.Errorf("failed to put dispute to world state: %v", err)
+	}
+
+	period.Status = "disputed"
+	return s.putSettlementPeriod(ctx, period)
+}
+
+func (s *CarbonCreditContract) readSettlementPeriod(ctx contractapi.TransactionContextInterface, periodID string) (*SettlementPeriod, error) {
+	periodJSON, err := ctx.GetStub().GetState("period-" + periodID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if periodJSON == nil {
+		return nil, fmt.Errorf("the settlement period %s does not exist", periodID)
+	}
+
+	var period SettlementPeriod
+	if err := json.Unmarshal(periodJSON, &period); err != nil {
+		return nil, err
+	}
+
+	return &period, nil
+}
+
+func (s *CarbonCreditContract) putSettlementPeriod(ctx contractapi.TransactionContextInterface, period *SettlementPeriod) error {
+	periodJSON, err := json.Marshal(period)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState("period-"+period.ID, periodJSON)
+}
+
+func (s *CarbonCreditContract) readObligation(ctx contractapi.TransactionContextInterface, periodID, ownerID string) (*Obligation, error) {
+	key, err := ctx.GetStub().CreateCompositeKey("obligation", []string{periodID, ownerID})
+	if err != nil {
+		return nil, err
+	}
+
+	obligationJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if obligationJSON == nil {
+		return &Obligation{PeriodID: periodID, OwnerID: ownerID}, nil
+	}
+
+	var obligation Obligation
+	if err := json.Unmarshal(obligationJSON, &obligation); err != nil {
+		return nil, err
+	}
+
+	return &obligation, nil
+}
+
+func (s *CarbonCreditContract) putObligation(ctx contractapi.TransactionContextInterface, obligation *Obligation) error {
+	key, err := ctx.GetStub().CreateCompositeKey("obligation", []string{obligation.PeriodID, obligation.OwnerID})
+	if err != nil {
+		return err
+	}
+
+	obligation.UpdatedAt = time.Now()
+	obligationJSON, err := json.Marshal(obligation)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, obligationJSON)
+}
+
+func (s *CarbonCreditContract) putSettlementStatement(ctx contractapi.TransactionContextInterface, statement *SettlementStatement) error {
+	statementJSON, err := json.Marshal(statement)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState("statement-"+statement.PeriodID+"-"+statement.OwnerID, statementJSON)
+}
+
+// computeSettlementDigest derives the summary digest stored in a settlement
+// statement's Signature field: an unkeyed SHA-256 hash of periodID, ownerID
+// and netPosition. It is not a cryptographic signature; anyone can recompute it.
+func computeSettlementDigest(periodID, ownerID string, netPosition float64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%f", periodID, ownerID, netPosition)))
+	return hex.EncodeToString(sum[:])
+}
+
+func stringInSlice(needle string, haystack []string) bool {
+	for _, candidate := range haystack {
+		if candidate == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// BridgeOperator represents a set of signers authorized to attest to
+// credits bridged in from an external registry (Verra, Gold Standard,
+// another Fabric channel). Threshold of the listed operator public keys
+// must sign before BridgeIn will mint a credit.
+type BridgeOperator struct {
+	RegistryID   string    `json:"registryId"`
+	Operators    []string  `json:"operators"` // operator public keys
+	Threshold    int       `json:"threshold"` // M of len(Operators) required
+	Active       bool      `json:"active"`
+	RegisteredAt time.Time `json:"registeredAt"`
+}
+
+// BridgeReceipt is the evidence emitted when a credit is bridged out to an
+// external registry, carrying enough metadata for that registry (or its
+// operators) to mint an equivalent credit on the other side. It carries no
+// on-chain-computed signature: this chain has no private key to sign with,
+// so the target registry's operators attest off-chain, from the emitted
+// event, before countersigning a BridgeIn.
+type BridgeReceipt struct {
+	ID             string    `json:"id"`
+	CreditID       string    `json:"creditId"`
+	OwnerID        string    `json:"ownerId"`
+	Amount         float64   `json:"amount"`
+	TargetRegistry string    `json:"targetRegistry"`
+	TargetAddress  string    `json:"targetAddress"`
+	ProjectID      string    `json:"projectId"`
+	Type           string    `json:"type"`
+	Nonce          string    `json:"nonce"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// RegisterBridgeOperator adds or replaces the M-of-N operator set trusted to
+// attest to credits bridged in from registryID. Each entry in operators is a
+// hex-encoded ed25519 public key; BridgeIn requires real signatures from at
+// least threshold of the matching private keys, which never appear on-chain.
+func (s *CarbonCreditContract) RegisterBridgeOperator(ctx contractapi.TransactionContextInterface, registryID string, operators []string, threshold int) error {
+	if threshold <= 0 || threshold > len(operators) {
+		return fmt.Errorf("threshold must be between 1 and %d", len(operators))
+	}
+	for _, operatorKey := range operators {
+		if _, err := decodeEd25519PublicKey(operatorKey); err != nil {
+			return err
+		}
+	}
+
+	bridgeOperator := BridgeOperator{
+		RegistryID:   registryID,
+		Operators:    operators,
+		Threshold:    threshold,
+		Active:       true,
+		RegisteredAt: time.Now(),
+	}
+
+	return s.putBridgeOperator(ctx, &bridgeOperator)
+}
+
+// RevokeBridgeOperator deactivates a registered bridge operator set so
+// BridgeIn no longer accepts its signatures
+func (s *CarbonCreditContract) RevokeBridgeOperator(ctx contractapi.TransactionContextInterface, registryID string) error {
+	bridgeOperator, err := s.readBridgeOperator(ctx, registryID)
+	if err != nil {
+		return err
+	}
+
+	bridgeOperator.Active = false
+	return s.putBridgeOperator(ctx, bridgeOperator)
+}
+
+// BridgeOut retires amount of creditID locally with retirementType "bridge"
+// and emits a BridgeReceipt event that targetRegistry's operators can use to
+// mint an equivalent credit via BridgeIn. The receipt is not signed on-chain
+// (see BridgeReceipt).
+func (s *CarbonCreditContract) BridgeOut(ctx contractapi.TransactionContextInterface, creditID, ownerID string, amount float64, targetRegistry, targetAddress string) error {
+	credit, err := s.ReadCredit(ctx, creditID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.RetireCredit(ctx, creditID, ownerID, amount, "bridge", fmt.Sprintf("bridged to %s", targetRegistry)); err != nil {
+		return err
+	}
+
+	receiptID := fmt.Sprintf("bridge-out-%s-%d", creditID, time.Now().Unix())
+	receipt := BridgeReceipt{
+		ID:             receiptID,
+		CreditID:       creditID,
+		OwnerID:        ownerID,
+		Amount:         amount,
+		TargetRegistry: targetRegistry,
+		TargetAddress:  targetAddress,
+		ProjectID:      credit.ProjectID,
+		Type:           credit.Type,
+		Nonce:          ctx.GetStub().GetTxID(),
+		CreatedAt:      time.Now(),
+	}
+
+	receiptJSON, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(receiptID, receiptJSON); err != nil {
+		return fmt.Errorf("failed to put bridge receipt to world state: %v", err)
+	}
+
+	return ctx.GetStub().SetEvent("BridgeOut", receiptJSON)
+}
+
+// BridgeIn mints a credit tagged with its origin registry after verifying
+// that at least the registered threshold of sourceRegistry's operators
+// produced a valid ed25519 signature over the bridged payload, and rejects
+// replays of an already-consumed receipt
+func (s *CarbonCreditContract) BridgeIn(ctx contractapi.TransactionContextInterface, sourceRegistry, sourceReceiptHash string, signatures []string, credit CarbonCredit) error {
+	consumedKey := "bridge-consumed-" + sourceReceiptHash
+	consumedJSON, err := ctx.GetStub().GetState(consumedKey)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if consumedJSON != nil {
+		return fmt.Errorf("source receipt %s has already been bridged in", sourceReceiptHash)
+	}
+
+	bridgeOperator, err := s.readBridgeOperator(ctx, sourceRegistry)
+	if err != nil {
+		return err
+	}
+	if !bridgeOperator.Active {
+		return fmt.Errorf("bridge operator set for %s has been revoked", sourceRegistry)
+	}
+
+	decodedSignatures := make([][]byte, 0, len(signatures))
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err != nil || len(decoded) != ed25519.SignatureSize {
+			continue
+		}
+		decodedSignatures = append(decodedSignatures, decoded)
+	}
+
+	message := bridgeInMessage(sourceRegistry, sourceReceiptHash, credit)
+	signed := 0
+	for _, operatorKey := range bridgeOperator.Operators {
+		publicKey, err := decodeEd25519PublicKey(operatorKey)
+		if err != nil {
+			return err
+		}
+		for _, signature := range decodedSignatures {
+			if ed25519.Verify(publicKey, message, signature) {
+				signed++
+				break
+			}
+		}
+	}
+	if signed < bridgeOperator.Threshold {
+		return fmt.Errorf("only %d of %d required operator signatures verified for %s", signed, bridgeOperator.Threshold, sourceRegistry)
+	}
+
+	exists, err := s.CreditExists(ctx, credit.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the credit %s already exists", credit.ID)
+	}
+
+	if credit.Metadata == nil {
+		credit.Metadata = make(map[string]interface{})
+	}
+	credit.Metadata["origin"] = sourceRegistry
+	credit.Status = "issued"
+	credit.IssuedDate = time.Now()
+	credit.BlockchainHash = ctx.GetStub().GetTxID()
+	credit.CreatedAt = time.Now()
+	credit.UpdatedAt = time.Now()
+
+	creditJSON, err := json.Marshal(credit)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(credit.ID, creditJSON); err != nil {
+		return err
+	}
+
+	if err := s.putBalance(ctx, &CreditBalance{CreditID: credit.ID, OwnerID: credit.OwnerID, Amount: credit.Amount}); err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(consumedKey, []byte(credit.ID)); err != nil {
+		return fmt.Errorf("failed to put consumed receipt to world state: %v", err)
+	}
+
+	return nil
+}
+
+// RevokeBridgedCredit zeroes out every current holder's balance of a bridged
+// credit when the source registry reports the underlying receipt was
+// invalidated, and marks the receipt as no longer available for reuse
+func (s *CarbonCreditContract) RevokeBridgedCredit(ctx contractapi.TransactionContextInterface, creditID, sourceReceiptHash string) error {
+	credit, err := s.ReadCredit(ctx, creditID)
+	if err != nil {
+		return err
+	}
+
+	consumedKey := "bridge-consumed-" + sourceReceiptHash
+	consumedJSON, err := ctx.GetStub().GetState(consumedKey)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if consumedJSON == nil || string(consumedJSON) != creditID {
+		return fmt.Errorf("source receipt %s was not used to bridge in credit %s", sourceReceiptHash, creditID)
+	}
+
+	holders, err := s.GetHoldersOf(ctx, creditID)
+	if err != nil {
+		return err
+	}
+	for _, holder := range holders {
+		holder.Amount = 0
+		if err := s.putBalance(ctx, holder); err != nil {
+			return err
+		}
+	}
+
+	credit.Status = "revoked"
+	credit.UpdatedAt = time.Now()
+	creditJSON, err := json.Marshal(credit)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(creditID, creditJSON); err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(consumedKey, []byte("revoked"))
+}
+
+func (s *CarbonCreditContract) readBridgeOperator(ctx contractapi.TransactionContextInterface, registryID string) (*BridgeOperator, error) {
+	operatorJSON, err := ctx.GetStub().GetState("bridge-operator-" + registryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if operatorJSON == nil {
+		return nil, fmt.Errorf("no bridge operator set is registered for %s", registryID)
+	}
+
+	var bridgeOperator BridgeOperator
+	if err := json.Unmarshal(operatorJSON, &bridgeOperator); err != nil {
+		return nil, err
+	}
+
+	return &bridgeOperator, nil
+}
+
+func (s *CarbonCreditContract) putBridgeOperator(ctx contractapi.TransactionContextInterface, bridgeOperator *BridgeOperator) error {
+	operatorJSON, err := json.Marshal(bridgeOperator)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState("bridge-operator-"+bridgeOperator.RegistryID, operatorJSON)
+}
+
+// bridgeInMessage is the byte string sourceRegistry's operators sign
+// off-chain to authorize minting credit via BridgeIn. It binds credit's ID,
+// ProjectID, Amount, OwnerID, Type, VerificationID and ExpiryDate, so a
+// threshold of operator signatures obtained for one recipient/type/expiry
+// can't be replayed with any of those fields substituted in by the caller.
+// MRVReportID, AttestationID, ParentCreditIDs and Metadata are not bound;
+// BridgeIn persists them as the caller supplies them.
+func bridgeInMessage(sourceRegistry, sourceReceiptHash string, credit CarbonCredit) []byte {
+	return []byte(fmt.Sprintf("%s|%s|%s|%s|%f|%s|%s|%s|%s",
+		sourceRegistry, sourceReceiptHash, credit.ID, credit.ProjectID, credit.Amount,
+		credit.OwnerID, credit.Type, credit.VerificationID, credit.ExpiryDate.Format(time.RFC3339)))
 }
 
 // InitLedger adds a base set of carbon credits to the ledger
@@ -76,8 +1598,8 @@ func (s *CarbonCreditContract) InitLedger(ctx contractapi.TransactionContextInte
 			MRVReportID:    "mrv-001",
 			BlockchainHash: "0x1234567890abcdef",
 			Metadata: map[string]interface{}{
-				"ecosystem": "mangrove",
-				"location":  "Southeast Asia",
+				"ecosystem":   "mangrove",
+				"location":    "Southeast Asia",
 				"methodology": "VCS VM0007",
 			},
 			CreatedAt: time.Now(),
@@ -100,8 +1622,14 @@ func (s *CarbonCreditContract) InitLedger(ctx contractapi.TransactionContextInte
 	return nil
 }
 
-// CreateCredit creates a new carbon credit
-func (s *CarbonCreditContract) CreateCredit(ctx contractapi.TransactionContextInterface, creditID, projectID, ownerID string, amount float64, creditType, verificationID, mrvReportID string) error {
+// CreateCredit creates a new carbon credit backed by a signed MRV attestation
+// bundle. rawPayloadHash is the content hash of the underlying satellite/
+// drone/IoT sensor payload, verifierDID identifies the registered verifier
+// that signed it, signature is the verifier's hex-encoded ed25519 signature
+// (produced off-chain, over attestationMessage) and is checked by
+// VerifyAttestation before IssueCredit will flip the credit to issued, and
+// measurementStart/measurementEnd (RFC3339) bound the window the readings cover.
+func (s *CarbonCreditContract) CreateCredit(ctx contractapi.TransactionContextInterface, creditID, projectID, ownerID string, amount float64, creditType, verificationID string, rawPayloadHash, verifierDID, signature, methodologyVersion, measurementStart, measurementEnd string) error {
 	exists, err := s.CreditExists(ctx, creditID)
 	if err != nil {
 		return err
@@ -110,6 +1638,40 @@ func (s *CarbonCreditContract) CreateCredit(ctx contractapi.TransactionContextIn
 		return fmt.Errorf("the credit %s already exists", creditID)
 	}
 
+	if _, err := s.readVerifier(ctx, verifierDID); err != nil {
+		return err
+	}
+
+	start, err := time.Parse(time.RFC3339, measurementStart)
+	if err != nil {
+		return fmt.Errorf("invalid measurementStart: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, measurementEnd)
+	if err != nil {
+		return fmt.Errorf("invalid measurementEnd: %v", err)
+	}
+
+	attestationID := "attestation-" + creditID
+	attestation := MRVAttestation{
+		ID:                 attestationID,
+		CreditID:           creditID,
+		RawPayloadHash:     rawPayloadHash,
+		VerifierDID:        verifierDID,
+		Signature:          signature,
+		MethodologyVersion: methodologyVersion,
+		MeasurementStart:   start,
+		MeasurementEnd:     end,
+		CreatedAt:          time.Now(),
+	}
+
+	attestationJSON, err := json.Marshal(attestation)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(attestationID, attestationJSON); err != nil {
+		return fmt.Errorf("failed to put attestation to world state: %v", err)
+	}
+
 	credit := CarbonCredit{
 		ID:             creditID,
 		ProjectID:      projectID,
@@ -120,7 +1682,7 @@ func (s *CarbonCreditContract) CreateCredit(ctx contractapi.TransactionContextIn
 		IssuedDate:     time.Now(),
 		ExpiryDate:     time.Now().AddDate(10, 0, 0), // 10 years expiry
 		VerificationID: verificationID,
-		MRVReportID:    mrvReportID,
+		AttestationID:  attestationID,
 		BlockchainHash: ctx.GetStub().GetTxID(),
 		Metadata:       make(map[string]interface{}),
 		CreatedAt:      time.Now(),
@@ -146,6 +1708,10 @@ func (s *CarbonCreditContract) IssueCredit(ctx contractapi.TransactionContextInt
 		return fmt.Errorf("credit %s is not in pending status", creditID)
 	}
 
+	if _, err := s.VerifyAttestation(ctx, creditID); err != nil {
+		return fmt.Errorf("cannot issue credit %s: %v", creditID, err)
+	}
+
 	credit.Status = "issued"
 	credit.IssuedDate = time.Now()
 	credit.UpdatedAt = time.Now()
@@ -155,7 +1721,11 @@ func (s *CarbonCreditContract) IssueCredit(ctx contractapi.TransactionContextInt
 		return err
 	}
 
-	return ctx.GetStub().PutState(creditID, creditJSON)
+	if err := ctx.GetStub().PutState(creditID, creditJSON); err != nil {
+		return err
+	}
+
+	return s.putBalance(ctx, &CreditBalance{CreditID: creditID, OwnerID: credit.OwnerID, Amount: credit.Amount})
 }
 
 // ReadCredit returns the carbon credit stored in the world state with given id
@@ -247,10 +1817,40 @@ func (s *CarbonCreditContract) GetAllCredits(ctx contractapi.TransactionContextI
 	return credits, nil
 }
 
-// GetCreditsByOwner returns all carbon credits owned by a specific owner
+// GetCreditsByOwner returns every carbon credit ownerID currently holds a
+// positive balance of. This is derived from the CreditBalance ledger rather
+// than CarbonCredit.OwnerID, which only reflects a credit's original
+// issuance and does not move with transfers, splits, or merges.
 func (s *CarbonCreditContract) GetCreditsByOwner(ctx contractapi.TransactionContextInterface, ownerID string) ([]*CarbonCredit, error) {
-	queryString := fmt.Sprintf(`{"selector":{"ownerId":"%s"}}`, ownerID)
-	return getQueryResultForQueryString(ctx, queryString)
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("balance", []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	var credits []*CarbonCredit
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var balance CreditBalance
+		if err := json.Unmarshal(kv.Value, &balance); err != nil {
+			return nil, err
+		}
+		if balance.OwnerID != ownerID || balance.Amount <= 0 {
+			continue
+		}
+
+		credit, err := s.ReadCredit(ctx, balance.CreditID)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, credit)
+	}
+
+	return credits, nil
 }
 
 // GetCreditsByProject returns all carbon credits for a specific project
@@ -265,27 +1865,20 @@ func (s *CarbonCreditContract) GetCreditsByStatus(ctx contractapi.TransactionCon
 	return getQueryResultForQueryString(ctx, queryString)
 }
 
-// TransferCredit transfers ownership of a carbon credit
+// TransferCredit transfers a balance of a carbon credit from one owner to
+// another. It moves CreditBalance entries via Transfer and leaves the
+// CarbonCredit issuance envelope untouched; use GetBalance/GetHoldersOf to
+// query current ownership rather than the credit's OwnerID field, which
+// reflects only the original issuance.
 func (s *CarbonCreditContract) TransferCredit(ctx contractapi.TransactionContextInterface, creditID, fromOwnerID, toOwnerID string, amount float64, transferType string, price float64) error {
-	credit, err := s.ReadCredit(ctx, creditID)
-	if err != nil {
+	if err := s.Transfer(ctx, creditID, fromOwnerID, toOwnerID, amount); err != nil {
 		return err
 	}
 
-	if credit.OwnerID != fromOwnerID {
-		return fmt.Errorf("credit %s is not owned by %s", creditID, fromOwnerID)
-	}
-
-	if credit.Status != "issued" {
-		return fmt.Errorf("credit %s is not in issued status", creditID)
-	}
-
-	if credit.Amount < amount {
-		return fmt.Errorf("insufficient credit amount. Available: %f, Requested: %f", credit.Amount, amount)
-	}
-
-	// Create transfer record
-	transferID := fmt.Sprintf("transfer-%s-%d", creditID, time.Now().Unix())
+	// Record transfer for audit/history purposes. GetTxID, not a timestamp,
+	// keys the record so two transfers of the same credit within the same
+	// second can't clobber each other's audit entry.
+	transferID := fmt.Sprintf("transfer-%s-%s", creditID, ctx.GetStub().GetTxID())
 	transfer := CreditTransfer{
 		ID:              transferID,
 		FromOwnerID:     fromOwnerID,
@@ -295,7 +1888,7 @@ func (s *CarbonCreditContract) TransferCredit(ctx contractapi.TransactionContext
 		TransferType:    transferType,
 		Price:           price,
 		TransactionHash: ctx.GetStub().GetTxID(),
-		Status:          "pending",
+		Status:          "completed",
 		CreatedAt:       time.Now(),
 	}
 
@@ -304,72 +1897,58 @@ func (s *CarbonCreditContract) TransferCredit(ctx contractapi.TransactionContext
 		return err
 	}
 
-	// Store transfer record
-	err = ctx.GetStub().PutState(transferID, transferJSON)
-	if err != nil {
-		return err
-	}
-
-	// Update credit ownership
-	if credit.Amount == amount {
-		// Full transfer
-		credit.OwnerID = toOwnerID
-		credit.Status = "transferred"
-	} else {
-		// Partial transfer - create new credit for remaining amount
-		remainingCreditID := fmt.Sprintf("%s-remaining-%d", creditID, time.Now().Unix())
-		remainingCredit := *credit
-		remainingCredit.ID = remainingCreditID
-		remainingCredit.Amount = credit.Amount - amount
-		remainingCredit.CreatedAt = time.Now()
-		remainingCredit.UpdatedAt = time.Now()
-
-		remainingCreditJSON, err := json.Marshal(remainingCredit)
-		if err != nil {
-			return err
-		}
-
-		err = ctx.GetStub().PutState(remainingCreditID, remainingCreditJSON)
-		if err != nil {
-			return err
-		}
+	return ctx.GetStub().PutState(transferID, transferJSON)
+}
 
-		// Update original credit
-		credit.OwnerID = toOwnerID
-		credit.Amount = amount
-		credit.Status = "transferred"
+// RetireCredit permanently retires amount of creditID out of ownerID's
+// balance by debiting the owner's CreditBalance. The CarbonCredit issuance
+// envelope is left untouched except that its Status is set to "retired" once
+// no holder retains a positive balance.
+func (s *CarbonCreditContract) RetireCredit(ctx contractapi.TransactionContextInterface, creditID, ownerID string, amount float64, retirementType, purpose string) error {
+	if amount <= 0 {
+		return fmt.Errorf("retirement amount must be positive")
 	}
 
-	credit.UpdatedAt = time.Now()
-	creditJSON, err := json.Marshal(credit)
+	balance, err := s.GetBalance(ctx, creditID, ownerID)
 	if err != nil {
 		return err
 	}
-
-	return ctx.GetStub().PutState(creditID, creditJSON)
-}
-
-// RetireCredit retires a carbon credit permanently
-func (s *CarbonCreditContract) RetireCredit(ctx contractapi.TransactionContextInterface, creditID, ownerID string, amount float64, retirementType, purpose string) error {
-	credit, err := s.ReadCredit(ctx, creditID)
-	if err != nil {
-		return err
+	if balance.Amount < amount {
+		return fmt.Errorf("insufficient balance for %s on credit %s. Available: %f, Requested: %f", ownerID, creditID, balance.Amount, amount)
 	}
 
-	if credit.OwnerID != ownerID {
-		return fmt.Errorf("credit %s is not owned by %s", creditID, ownerID)
+	balance.Amount -= amount
+	if err := s.putBalance(ctx, balance); err != nil {
+		return err
 	}
 
-	if credit.Status != "issued" {
-		return fmt.Errorf("credit %s is not in issued status", creditID)
+	holders, err := s.GetHoldersOf(ctx, creditID)
+	if err != nil {
+		return err
 	}
+	if len(holders) == 0 {
+		credit, err := s.ReadCredit(ctx, creditID)
+		if err != nil {
+			return err
+		}
+		credit.Status = "retired"
+		credit.UpdatedAt = time.Now()
 
-	if credit.Amount < amount {
-		return fmt.Errorf("insufficient credit amount. Available: %f, Requested: %f", credit.Amount, amount)
+		creditJSON, err := json.Marshal(credit)
+		if err != nil {
+			return err
+		}
+		if err := ctx.GetStub().PutState(creditID, creditJSON); err != nil {
+			return err
+		}
 	}
 
-	// Create retirement record
-	retirementID := fmt.Sprintf("retirement-%s-%d", creditID, time.Now().Unix())
+	// Create retirement record. GetTxID, not a timestamp, keys the record so
+	// two retirements of the same credit within the same second can't
+	// collide and silently overwrite one another's world-state entry - the
+	// same guarantee SubmitRetirement's settled-<retirementID> marker relies
+	// on being unique per retirement.
+	retirementID := fmt.Sprintf("retirement-%s-%s", creditID, ctx.GetStub().GetTxID())
 	retirement := CreditRetirement{
 		ID:             retirementID,
 		CreditID:       creditID,
@@ -386,29 +1965,7 @@ func (s *CarbonCreditContract) RetireCredit(ctx contractapi.TransactionContextIn
 		return err
 	}
 
-	// Store retirement record
-	err = ctx.GetStub().PutState(retirementID, retirementJSON)
-	if err != nil {
-		return err
-	}
-
-	// Update credit status
-	if credit.Amount == amount {
-		// Full retirement
-		credit.Status = "retired"
-	} else {
-		// Partial retirement
-		credit.Amount = credit.Amount - amount
-		credit.Status = "partially_retired"
-	}
-
-	credit.UpdatedAt = time.Now()
-	creditJSON, err := json.Marshal(credit)
-	if err != nil {
-		return err
-	}
-
-	return ctx.GetStub().PutState(creditID, creditJSON)
+	return ctx.GetStub().PutState(retirementID, retirementJSON)
 }
 
 // GetCreditHistory returns the transaction history for a specific credit
@@ -443,20 +2000,55 @@ func (s *CarbonCreditContract) GetCreditHistory(ctx contractapi.TransactionConte
 		history = append(history, historyRecord)
 	}
 
+	if attestation, err := s.ReadAttestation(ctx, creditID); err == nil {
+		history = append(history, map[string]interface{}{
+			"attestation": attestation,
+		})
+	}
+
 	return history, nil
 }
 
-// GetTotalCreditsByType returns the total amount of credits by type
+// GetTotalCreditsByType returns the total amount of creditType currently
+// held across all balances. This sums the CreditBalance ledger rather than
+// CarbonCredit.Amount, which is fixed at issuance: summing it directly would
+// count a credit's full original amount even after Split or Merge moved
+// that amount out into other envelopes, overstating supply.
 func (s *CarbonCreditContract) GetTotalCreditsByType(ctx contractapi.TransactionContextInterface, creditType string) (float64, error) {
-	queryString := fmt.Sprintf(`{"selector":{"type":"%s","status":"issued"}}`, creditType)
-	credits, err := getQueryResultForQueryString(ctx, queryString)
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("balance", []string{})
 	if err != nil {
 		return 0, err
 	}
+	defer iterator.Close()
 
+	typeByCreditID := make(map[string]string)
 	total := 0.0
-	for _, credit := range credits {
-		total += credit.Amount
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var balance CreditBalance
+		if err := json.Unmarshal(kv.Value, &balance); err != nil {
+			return 0, err
+		}
+		if balance.Amount <= 0 {
+			continue
+		}
+
+		typ, cached := typeByCreditID[balance.CreditID]
+		if !cached {
+			credit, err := s.ReadCredit(ctx, balance.CreditID)
+			if err != nil {
+				return 0, err
+			}
+			typ = credit.Type
+			typeByCreditID[balance.CreditID] = typ
+		}
+		if typ == creditType {
+			total += balance.Amount
+		}
 	}
 
 	return total, nil
@@ -499,4 +2091,3 @@ func main() {
 		fmt.Printf("Error starting carbon credit chaincode: %v", err)
 	}
 }
-